@@ -0,0 +1,69 @@
+package eureka
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// startAdminServer starts an HTTP listener for operator-driven status
+// overrides when EUREKA_ADMIN_ADDR is set: PUT /status?instance=<id>&status=<status>
+// takes an instance out of rotation without touching the container.
+func startAdminServer(adapter *EurekaAdapter) {
+	addr := os.Getenv("EUREKA_ADMIN_ADDR")
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		instanceId := req.URL.Query().Get("instance")
+		status := req.URL.Query().Get("status")
+		if instanceId == "" || status == "" {
+			http.Error(w, "instance and status query parameters are required", http.StatusBadRequest)
+			return
+		}
+
+		if err := adapter.SetStatusOverride(instanceId, status); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+
+	go func() {
+		log.Println("eureka: admin endpoint listening on", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Println("eureka: admin endpoint stopped:", err)
+		}
+	}()
+}
+
+// SetStatusOverride pushes a status override for instanceId to the Eureka
+// cluster and pins the adapter's local view to it, so subsequent health checks
+// and heartbeats don't overwrite it.
+func (r *EurekaAdapter) SetStatusOverride(instanceId string, status string) error {
+	r.servicesMutex.Lock()
+	registeredService, found := r.registeredServices[instanceId]
+	r.servicesMutex.Unlock()
+	if !found {
+		return fmt.Errorf("no registered service with instanceId %s", instanceId)
+	}
+
+	if err := r.client.SetStatusOverride(registeredService.registration.App, instanceId, status); err != nil {
+		return err
+	}
+
+	r.servicesMutex.Lock()
+	registeredService.overridden = true
+	registeredService.registration.Status = status
+	r.servicesMutex.Unlock()
+	log.Println("Set status override for", instanceId, "to", status)
+	return nil
+}
@@ -0,0 +1,374 @@
+package eureka
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pdok/go-eureka-client/eureka"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	quarantineTTL            = 15 * time.Minute
+	quarantineFlushThreshold = 0.66
+)
+
+var quarantinedServers = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "registrator",
+	Subsystem: "eureka",
+	Name:      "quarantined_servers",
+	Help:      "Number of Eureka cluster members currently quarantined after failed requests.",
+})
+
+func init() {
+	prometheus.MustRegister(quarantinedServers)
+}
+
+// eurekaServer is a single member of an Eureka cluster, addressed by its base URL.
+type eurekaServer struct {
+	url    string
+	client *eureka.Client
+}
+
+// serverCluster fronts a list of Eureka servers and implements the client-side
+// failover strategy used by the Netflix Java client: requests always go to the
+// first non-quarantined server, and a server that errors out gets quarantined
+// until the quarantine set is flushed.
+type serverCluster struct {
+	mu          sync.Mutex
+	servers     []*eurekaServer
+	quarantined map[string]time.Time
+}
+
+// newServerCluster builds a serverCluster from the given Eureka server URLs,
+// shuffled and then reordered so that servers EUREKA_ZONE_URLS maps to the
+// local availability zone come first.
+func newServerCluster(urls []string) *serverCluster {
+	servers := make([]*eurekaServer, len(urls))
+	for i, u := range urls {
+		servers[i] = &eurekaServer{url: u, client: eureka.NewClient([]string{u})}
+	}
+
+	rand.Shuffle(len(servers), func(i, j int) {
+		servers[i], servers[j] = servers[j], servers[i]
+	})
+
+	if zone := availabilityZone(); zone != "" {
+		if local := zoneServerUrls(zone); len(local) > 0 {
+			sort.SliceStable(servers, func(i, j int) bool {
+				return local[servers[i].url] && !local[servers[j].url]
+			})
+		} else {
+			log.Println("eureka: EUREKA_AVAILABILITY_ZONE/EUREKA_REGION/AWS_ZONE set to", zone, "but EUREKA_ZONE_URLS has no entry for it, zone-aware ordering is a no-op")
+		}
+	}
+
+	for _, s := range servers {
+		log.Println("eureka: cluster member", s.url)
+	}
+
+	return &serverCluster{servers: servers, quarantined: make(map[string]time.Time)}
+}
+
+// availabilityZone resolves the zone this instance runs in, used together
+// with EUREKA_ZONE_URLS to bring same-zone Eureka servers to the front.
+func availabilityZone() string {
+	if z := os.Getenv("EUREKA_AVAILABILITY_ZONE"); z != "" {
+		return z
+	}
+	if z := os.Getenv("EUREKA_REGION"); z != "" {
+		return z
+	}
+	// Docker labels such as AWS_ZONE are typically surfaced to the container as
+	// an environment variable of the same name.
+	return os.Getenv("AWS_ZONE")
+}
+
+// zoneServerUrls reads EUREKA_ZONE_URLS, a real zone->server mapping in the
+// form "zone1=url1,url2;zone2=url3", and returns the set of URLs configured
+// for the given zone, or nil if the zone has no entry.
+func zoneServerUrls(zone string) map[string]bool {
+	mapping := os.Getenv("EUREKA_ZONE_URLS")
+	if mapping == "" {
+		return nil
+	}
+
+	for _, group := range strings.Split(mapping, ";") {
+		zoneAndUrls := strings.SplitN(group, "=", 2)
+		if len(zoneAndUrls) != 2 || strings.TrimSpace(zoneAndUrls[0]) != zone {
+			continue
+		}
+
+		urls := make(map[string]bool)
+		for _, u := range strings.Split(zoneAndUrls[1], ",") {
+			urls[strings.TrimSpace(u)] = true
+		}
+		return urls
+	}
+	return nil
+}
+
+// activeServers returns the cluster members currently eligible to receive
+// requests, flushing the quarantine set first if it is stale or too large.
+func (c *serverCluster) activeServers() []*eurekaServer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maybeFlushQuarantine()
+
+	if len(c.quarantined) == 0 {
+		return c.servers
+	}
+
+	active := make([]*eurekaServer, 0, len(c.servers))
+	for _, s := range c.servers {
+		if _, quarantined := c.quarantined[s.url]; !quarantined {
+			active = append(active, s)
+		}
+	}
+	if len(active) == 0 {
+		// Every server is quarantined, better to retry them all than give up.
+		return c.servers
+	}
+	return active
+}
+
+func (c *serverCluster) maybeFlushQuarantine() {
+	if len(c.quarantined) == 0 {
+		return
+	}
+
+	flush := float64(len(c.quarantined))/float64(len(c.servers)) >= quarantineFlushThreshold
+	if !flush {
+		for _, since := range c.quarantined {
+			if time.Since(since) >= quarantineTTL {
+				flush = true
+				break
+			}
+		}
+	}
+
+	if flush {
+		log.Println("eureka: quarantine threshold reached, flushing", len(c.quarantined), "cluster member(s) back into rotation")
+		c.quarantined = make(map[string]time.Time)
+		quarantinedServers.Set(0)
+	}
+}
+
+func (c *serverCluster) quarantine(server *eurekaServer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, already := c.quarantined[server.url]; !already {
+		log.Println("eureka: quarantining cluster member", server.url)
+		c.quarantined[server.url] = time.Now()
+		quarantinedServers.Set(float64(len(c.quarantined)))
+	}
+}
+
+func (c *serverCluster) unquarantine(server *eurekaServer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, quarantined := c.quarantined[server.url]; quarantined {
+		log.Println("eureka: cluster member recovered", server.url)
+		delete(c.quarantined, server.url)
+		quarantinedServers.Set(float64(len(c.quarantined)))
+	}
+}
+
+// RegisterInstance tries every active cluster member in order until one
+// succeeds, quarantining each one that fails along the way.
+func (c *serverCluster) RegisterInstance(instance *eureka.InstanceInfo) error {
+	var lastErr error
+	for _, server := range c.activeServers() {
+		err := server.client.RegisterInstance(instance)
+		if err == nil {
+			c.unquarantine(server)
+			return nil
+		}
+		log.Println("eureka: RegisterInstance failed on", server.url, ":", err)
+		c.quarantine(server)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// RegisterInstances writes a batch of instances to the cluster, using
+// RegisterInstance's own failover per instance since the underlying client
+// has no native bulk registration call. This does NOT reduce the number of
+// requests the Eureka server sees when many distinct instances transition at
+// once: it still fires one RegisterInstance call per instance, sequentially.
+// The only savings is upstream in scheduler.queueWrite, which coalesces
+// repeated writes for the *same* instance within the batch window.
+func (c *serverCluster) RegisterInstances(instances []*eureka.InstanceInfo) (failed int, err error) {
+	for _, instance := range instances {
+		if regErr := c.RegisterInstance(instance); regErr != nil {
+			failed++
+			err = regErr
+		}
+	}
+	return failed, err
+}
+
+// UnregisterInstance tries every active cluster member in order until one succeeds.
+func (c *serverCluster) UnregisterInstance(instance *eureka.InstanceInfo) error {
+	var lastErr error
+	for _, server := range c.activeServers() {
+		err := server.client.UnregisterInstance(instance)
+		if err == nil {
+			c.unquarantine(server)
+			return nil
+		}
+		log.Println("eureka: UnregisterInstance failed on", server.url, ":", err)
+		c.quarantine(server)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// SendHeartbeat tries every active cluster member in order until one
+// succeeds, and also surfaces any OverriddenStatus Eureka echoes back on the
+// heartbeat response. Eureka's heartbeat reply carries the server's own copy
+// of the instance, and an operator-applied status override shows up there
+// immediately, instead of waiting for the next periodic Ping/reconcileOverrides
+// poll. The vendored client's SendHeartbeat discards the response body, so
+// this goes over raw HTTP the same way SetStatusOverride/putStatusOverride do.
+//
+// A 404 means the lease isn't known to that server (not yet registered, or
+// expired) and is normal, expected behavior telling the caller to re-register
+// - it is not a sign that the server itself is unhealthy, so unlike a
+// transport/5xx failure it does not quarantine the server.
+func (c *serverCluster) SendHeartbeat(instance *eureka.InstanceInfo) (succeeded bool, overriddenStatus string) {
+	for _, server := range c.activeServers() {
+		overridden, leaseNotFound, err := sendHeartbeat(server.url, instance)
+		if err == nil {
+			c.unquarantine(server)
+			return true, overridden
+		}
+		if leaseNotFound {
+			log.Println("eureka: heartbeat lease for", instance.InstanceId, "not found on", server.url, ", needs to re-register")
+			return false, ""
+		}
+		log.Println("eureka: SendHeartbeat failed on", server.url, ":", err)
+		c.quarantine(server)
+	}
+	return false, ""
+}
+
+// sendHeartbeat issues the PUT /apps/{app}/{id} heartbeat request directly,
+// mirroring putStatusOverride, because we need the response body rather than
+// just a success/failure bool.
+func sendHeartbeat(baseUrl string, instance *eureka.InstanceInfo) (overriddenStatus string, leaseNotFound bool, err error) {
+	endpoint := fmt.Sprintf("%s/apps/%s/%s?status=%s", strings.TrimRight(baseUrl, "/"), instance.App, instance.InstanceId, url.QueryEscape(instance.Status))
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", true, fmt.Errorf("lease for %s not found on %s", instance.InstanceId, baseUrl)
+	}
+	if resp.StatusCode >= 300 {
+		return "", false, fmt.Errorf("unexpected status %d sending heartbeat for %s", resp.StatusCode, instance.InstanceId)
+	}
+
+	// The override, if any, rides along on the peer InstanceInfo Eureka
+	// returns with the heartbeat response; a non-2xx-but-already-handled
+	// response or a body we can't decode just means no override to apply yet.
+	var peer struct {
+		Instance eureka.InstanceInfo `json:"instance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&peer); err == nil {
+		overriddenStatus = peer.Instance.OverriddenStatus
+	}
+	return overriddenStatus, false, nil
+}
+
+// GetApplications tries every active cluster member in order until one succeeds.
+func (c *serverCluster) GetApplications() (*eureka.Applications, error) {
+	var lastErr error
+	for _, server := range c.activeServers() {
+		apps, err := server.client.GetApplications()
+		if err == nil {
+			c.unquarantine(server)
+			return apps, nil
+		}
+		log.Println("eureka: GetApplications failed on", server.url, ":", err)
+		c.quarantine(server)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// GetDelta tries every active cluster member in order until one succeeds.
+func (c *serverCluster) GetDelta() (*eureka.Applications, error) {
+	var lastErr error
+	for _, server := range c.activeServers() {
+		delta, err := server.client.GetDelta()
+		if err == nil {
+			c.unquarantine(server)
+			return delta, nil
+		}
+		log.Println("eureka: GetDelta failed on", server.url, ":", err)
+		c.quarantine(server)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// SetStatusOverride tries every active cluster member in order until one
+// accepts the status override for app/instanceId.
+func (c *serverCluster) SetStatusOverride(app string, instanceId string, status string) error {
+	var lastErr error
+	for _, server := range c.activeServers() {
+		err := putStatusOverride(server.url, app, instanceId, status)
+		if err == nil {
+			c.unquarantine(server)
+			return nil
+		}
+		log.Println("eureka: SetStatusOverride failed on", server.url, ":", err)
+		c.quarantine(server)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// putStatusOverride issues the PUT /apps/{app}/{id}/status?value={status}
+// request Eureka uses for operator-driven status overrides.
+func putStatusOverride(baseUrl string, app string, instanceId string, status string) error {
+	endpoint := fmt.Sprintf("%s/apps/%s/%s/status?value=%s", strings.TrimRight(baseUrl, "/"), app, instanceId, url.QueryEscape(status))
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d setting override for %s", resp.StatusCode, instanceId)
+	}
+	return nil
+}
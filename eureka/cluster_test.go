@@ -0,0 +1,100 @@
+package eureka
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pdok/go-eureka-client/eureka"
+)
+
+func TestZoneServerUrls(t *testing.T) {
+	t.Setenv("EUREKA_ZONE_URLS", "zone1=http://a,http://b;zone2=http://c")
+
+	got := zoneServerUrls("zone1")
+	want := []string{"http://a", "http://b"}
+	if len(got) != len(want) {
+		t.Fatalf("zoneServerUrls(zone1) = %v, want %v", got, want)
+	}
+	for _, u := range want {
+		if !got[u] {
+			t.Errorf("zoneServerUrls(zone1) missing %q", u)
+		}
+	}
+
+	if got := zoneServerUrls("zone3"); got != nil {
+		t.Errorf("zoneServerUrls(zone3) = %v, want nil for an unmapped zone", got)
+	}
+}
+
+func TestMaybeFlushQuarantineAtThreshold(t *testing.T) {
+	c := &serverCluster{
+		servers:     []*eurekaServer{{url: "a"}, {url: "b"}, {url: "c"}},
+		quarantined: map[string]time.Time{"a": time.Now(), "b": time.Now()},
+	}
+
+	// 2 of 3 servers quarantined is >= the 66% flush threshold.
+	c.maybeFlushQuarantine()
+	if len(c.quarantined) != 0 {
+		t.Errorf("quarantine set not flushed at threshold, got %v", c.quarantined)
+	}
+}
+
+func TestMaybeFlushQuarantineBelowThreshold(t *testing.T) {
+	c := &serverCluster{
+		servers:     []*eurekaServer{{url: "a"}, {url: "b"}, {url: "c"}},
+		quarantined: map[string]time.Time{"a": time.Now()},
+	}
+
+	c.maybeFlushQuarantine()
+	if len(c.quarantined) != 1 {
+		t.Errorf("quarantine set flushed below both the threshold and the TTL, got %v", c.quarantined)
+	}
+}
+
+func TestSendHeartbeatStatusHandling(t *testing.T) {
+	cases := []struct {
+		name              string
+		statusCode        int
+		wantErr           bool
+		wantLeaseNotFound bool
+	}{
+		{"success", http.StatusOK, false, false},
+		{"lease not found", http.StatusNotFound, true, true},
+		{"server error", http.StatusInternalServerError, true, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer server.Close()
+
+			_, leaseNotFound, err := sendHeartbeat(server.URL, &eureka.InstanceInfo{InstanceId: "i1", App: "APP-A", Status: "UP"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if leaseNotFound != tc.wantLeaseNotFound {
+				t.Errorf("leaseNotFound = %v, want %v", leaseNotFound, tc.wantLeaseNotFound)
+			}
+		})
+	}
+}
+
+func TestSendHeartbeatDoesNotQuarantineOnLeaseNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := newServerCluster([]string{server.URL})
+	succeeded, overriddenStatus := c.SendHeartbeat(&eureka.InstanceInfo{InstanceId: "i1", App: "APP-A", Status: "UP"})
+	if succeeded || overriddenStatus != "" {
+		t.Fatalf("SendHeartbeat() = (%v, %q), want (false, \"\") on a 404", succeeded, overriddenStatus)
+	}
+	if len(c.quarantined) != 0 {
+		t.Errorf("a 404 lease-not-found response should not quarantine the server, got %v", c.quarantined)
+	}
+}
@@ -0,0 +1,70 @@
+package eureka
+
+import (
+	"github.com/pdok/go-eureka-client/eureka"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ec2MetadataBaseUrl = "http://169.254.169.254/latest/meta-data/"
+
+// The metadata service is link-local and normally answers in milliseconds; a
+// short timeout and no retry keeps a slow/unreachable service (misconfigured
+// EUREKA_DATACENTER, non-EC2 host) from stalling the first Register() call.
+const ec2MetadataTimeout = 1 * time.Second
+
+var (
+	dataCenterOnce       sync.Once
+	cachedDataCenterInfo eureka.DataCenterInfo
+)
+
+// dataCenterInfo returns this instance's DataCenterInfo, resolving it once per
+// process: AWS EC2 metadata when EUREKA_DATACENTER=Amazon, MyOwn otherwise.
+func dataCenterInfo() eureka.DataCenterInfo {
+	dataCenterOnce.Do(func() {
+		if os.Getenv("EUREKA_DATACENTER") == "Amazon" {
+			cachedDataCenterInfo = fetchAmazonDataCenterInfo()
+		} else {
+			cachedDataCenterInfo = eureka.DataCenterInfo{Name: "MyOwn"}
+		}
+	})
+	return cachedDataCenterInfo
+}
+
+func fetchAmazonDataCenterInfo() eureka.DataCenterInfo {
+	metadata := eureka.AmazonMetadataType{
+		InstanceId:       fetchEc2Metadata("instance-id"),
+		AmiId:            fetchEc2Metadata("ami-id"),
+		AvailabilityZone: fetchEc2Metadata("placement/availability-zone"),
+		InstanceType:     fetchEc2Metadata("instance-type"),
+		PublicHostname:   fetchEc2Metadata("public-hostname"),
+		LocalHostname:    fetchEc2Metadata("local-hostname"),
+		PublicIpv4:       fetchEc2Metadata("public-ipv4"),
+		LocalIpv4:        fetchEc2Metadata("local-ipv4"),
+	}
+	log.Println("eureka: resolved Amazon DataCenterInfo for instance", metadata.InstanceId, "in zone", metadata.AvailabilityZone)
+	return eureka.DataCenterInfo{Name: "Amazon", Metadata: metadata}
+}
+
+var ec2MetadataClient = http.Client{Timeout: ec2MetadataTimeout}
+
+func fetchEc2Metadata(path string) string {
+	resp, err := ec2MetadataClient.Get(ec2MetadataBaseUrl + path)
+	if err != nil {
+		log.Println("eureka: failed to fetch EC2 metadata", path, ":", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("eureka: failed to read EC2 metadata", path, ":", err)
+		return ""
+	}
+	return strings.TrimSpace(string(body))
+}
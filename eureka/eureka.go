@@ -9,9 +9,9 @@ import (
 	"fmt"
 	"os"
 	"time"
-	"net/http"
-	"io/ioutil"
+	"sort"
 	"strings"
+	"sync"
 )
 
 func init() {
@@ -44,54 +44,185 @@ type Factory struct{}
 func (f *Factory) New(uri *url.URL) bridge.RegistryAdapter {
 
 	eureka.SetDebugEnabled(isDebugEnabled())
-	client := eureka.NewClient([]string{
-		"http://" + uri.Host + uri.Path,
-	})
 
-	return &EurekaAdapter{client: client, registeredServices: make(map[string]RegisteredService), knownApplications: make(map[string]eureka.Application)}
+	hosts := strings.Split(uri.Host, ",")
+	urls := make([]string, len(hosts))
+	for i, host := range hosts {
+		urls[i] = "http://" + host + uri.Path
+	}
+	client := newServerCluster(urls)
+
+	adapter := &EurekaAdapter{client: client, registeredServices: make(map[string]*RegisteredService), knownApplications: make(map[string]eureka.Application)}
+	adapter.scheduler = newScheduler(adapter)
+	startAdminServer(adapter)
+	return adapter
 }
 
 type EurekaAdapter struct {
-	client             *eureka.Client
-	registeredServices map[string]RegisteredService
+	client             *serverCluster
+	scheduler          *scheduler
+	registeredServices map[string]*RegisteredService
+	servicesMutex      sync.Mutex
 	knownApplications  map[string]eureka.Application
+	knownMutex         sync.Mutex
+	hasSnapshot        bool
 }
 
 type RegisteredService struct {
-	ticker       *time.Ticker
-	statusUrl    string
-	registration *eureka.InstanceInfo
-	stop         chan struct{}
+	cancel           func()
+	checker          HealthChecker
+	registration     *eureka.InstanceInfo
+	consecutiveFails int
+	deregisterAfter  int
+	overridden       bool
 }
 
-// Ping will try to connect to eureka by attempting to retrieve the current list of applications.
+// Ping will try to connect to eureka and keep knownApplications in sync with the
+// registry. The first call does a full fetch; every call after that applies the
+// delta since the last fetch, falling back to a full fetch if the resulting
+// local hashcode diverges from the server's.
 func (r *EurekaAdapter) Ping() error {
+	if !r.hasSnapshot {
+		return r.fullResync()
+	}
+
+	delta, err := r.client.GetDelta()
+	if err != nil {
+		return err
+	}
+
+	r.knownMutex.Lock()
+	for _, application := range delta.Applications {
+		for _, instance := range application.Instances {
+			r.applyDelta(application.Name, instance)
+		}
+	}
+	localHashcode := computeAppsHashcode(r.knownApplications)
+	r.knownMutex.Unlock()
 
+	if localHashcode != delta.AppsHashcode {
+		log.Println("Local registry hashcode", localHashcode, "diverged from server hashcode", delta.AppsHashcode, ", falling back to a full resync")
+		return r.fullResync()
+	}
+
+	r.reconcileOverrides()
+	return nil
+}
+
+// fullResync replaces knownApplications wholesale with a fresh /apps snapshot.
+func (r *EurekaAdapter) fullResync() error {
 	eurekaApps, err := r.client.GetApplications()
 	if err != nil {
 		return err
 	}
 
-	//Store current situation as known in Eureka for a while
+	knownApplications := make(map[string]eureka.Application)
 	for _, application := range eurekaApps.Applications {
-		r.knownApplications[application.Name] = application
+		knownApplications[application.Name] = application
 	}
-	log.Println("Already registered number of applications: " , len(r.knownApplications))
 
-	//Clear initial situation after 90 seconds, first refresh comes at 60 seconds (ttl)
-	timer := time.NewTimer(90 * time.Second)
-	go func() {
-		<- timer.C
-		for k := range r.knownApplications {
-			delete(r.knownApplications, k)
-		}
-		log.Println("Cleared the known applications")
-	}()
+	r.knownMutex.Lock()
+	r.knownApplications = knownApplications
+	r.knownMutex.Unlock()
+	r.hasSnapshot = true
 
-	log.Println("Eureka AppsHashcode: ", eurekaApps.AppsHashcode)
+	log.Println("Full resync, known number of applications: ", len(knownApplications), "AppsHashcode: ", eurekaApps.AppsHashcode)
+	r.reconcileOverrides()
 	return nil
 }
 
+// reconcileOverrides compares every registered service against the server-side
+// view in knownApplications. A service whose OverriddenStatus is set there
+// (e.g. an operator put it OUT_OF_SERVICE) has its status pinned to that value
+// and is excluded from local health-check driven status writes until the
+// override is lifted.
+func (r *EurekaAdapter) reconcileOverrides() {
+	r.knownMutex.Lock()
+	defer r.knownMutex.Unlock()
+	r.servicesMutex.Lock()
+	defer r.servicesMutex.Unlock()
+
+	for instanceId, registeredService := range r.registeredServices {
+		application, found := r.knownApplications[registeredService.registration.App]
+		if !found {
+			continue
+		}
+
+		overridden := false
+		for _, instance := range application.Instances {
+			if instance.InstanceId != instanceId {
+				continue
+			}
+			if instance.OverriddenStatus != "" && instance.OverriddenStatus != "UNKNOWN" {
+				overridden = true
+				if registeredService.registration.Status != instance.OverriddenStatus {
+					log.Println("Status override", instance.OverriddenStatus, "in effect for", instanceId, ", suppressing local health checks")
+					registeredService.registration.Status = instance.OverriddenStatus
+				}
+			}
+			break
+		}
+		registeredService.overridden = overridden
+	}
+}
+
+// applyDelta merges a single delta instance into knownApplications. Callers
+// must hold knownMutex.
+func (r *EurekaAdapter) applyDelta(appName string, instance eureka.InstanceInfo) {
+	application, found := r.knownApplications[appName]
+	if !found {
+		application = eureka.Application{Name: appName}
+	}
+
+	switch instance.ActionType {
+	case "DELETED":
+		for i, existing := range application.Instances {
+			if existing.InstanceId == instance.InstanceId {
+				application.Instances = append(application.Instances[:i], application.Instances[i+1:]...)
+				break
+			}
+		}
+	default: // ADDED, MODIFIED
+		replaced := false
+		for i, existing := range application.Instances {
+			if existing.InstanceId == instance.InstanceId {
+				application.Instances[i] = instance
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			application.Instances = append(application.Instances, instance)
+		}
+	}
+
+	r.knownApplications[appName] = application
+}
+
+// computeAppsHashcode recomputes the Eureka registry hashcode from a set of
+// known applications: instance statuses sorted alphabetically and concatenated
+// as "STATUS_count_" pairs.
+func computeAppsHashcode(apps map[string]eureka.Application) string {
+	counts := make(map[string]int)
+	for _, application := range apps {
+		for _, instance := range application.Instances {
+			counts[instance.Status]++
+		}
+	}
+
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	var hashcode strings.Builder
+	for _, status := range statuses {
+		hashcode.WriteString(fmt.Sprintf("%s_%d_", status, counts[status]))
+	}
+	return hashcode.String()
+}
+
 func instanceInformation(service *bridge.Service) *eureka.InstanceInfo {
 
 	application := service.Name
@@ -113,71 +244,49 @@ func instanceInformation(service *bridge.Service) *eureka.InstanceInfo {
 		createMetadataMap(registration)
 		registration.Metadata.Map["depends_on"] = path
 	}
-	return registration
-}
-func createMetadataMap(registration *eureka.InstanceInfo) {
-	if registration.Metadata == nil {
-		registration.Metadata = &eureka.MetaData{
-			Map: make(map[string]string),
-		}
-	}
-}
 
-func GetWithRetry(url string) (*http.Response, error) {
-	timeout := time.Duration(15 * time.Second)
-	client := http.Client{
-		Timeout: timeout,
+	vipAddress := application
+	if v := service.Attrs["vip_address"]; v != "" {
+		vipAddress = v
 	}
-	resp, err := client.Get(url)
-	if err != nil {
-		eureka.GetEurekaLogger().Errorf("First attempt failed, error in fetching url %s: %s", url, err.Error())
-		return client.Get(url)
+	secureVipAddress := vipAddress
+	if v := service.Attrs["secure_vip_address"]; v != "" {
+		secureVipAddress = v
 	}
-	return resp, err
-}
+	registration.VipAddress = vipAddress
+	registration.SecureVipAddress = secureVipAddress
 
-func getCurrentStatus(statusUrl string) string {
-	resp, err := GetWithRetry(statusUrl)
-	if err != nil {
-		eureka.GetEurekaLogger().Errorf("Error in fetching status from url %s: %s", statusUrl, err.Error())
-		return "DOWN"
-	}
-	defer resp.Body.Close()
-	body, parseError := ioutil.ReadAll(resp.Body)
-
-	if parseError != nil {
-		eureka.GetEurekaLogger().Errorf("Error parsing response body from url %s body: %s", statusUrl, parseError.Error())
-		return "DOWN"
-	} else {
-		if ( resp.StatusCode == http.StatusOK) {
-			eureka.GetEurekaLogger().Debug("Service is UP")
-			return "UP"
+	if securePort := service.Attrs["secure_port"]; securePort != "" {
+		if v, err := strconv.Atoi(securePort); err != nil {
+			log.Println("eureka: secure_port must be valid int", err)
 		} else {
-			eureka.GetEurekaLogger().Errorf("Service is DOWN. Response from %s: %s", statusUrl, string(body))
-			return "DOWN"
+			registration.SecurePort = eureka.PortWrapper{Port: v, Enabled: true}
 		}
 	}
-}
-
-func checkHealth(registeredService *RegisteredService, client *eureka.Client) {
-	currentStatus := registeredService.registration.Status
-	newStatus := getCurrentStatus(registeredService.statusUrl)
 
-	if (currentStatus != newStatus) {
-		registeredService.registration.Status = newStatus
-		client.RegisterInstance(registeredService.registration) //Send status change
+	baseUrl := fmt.Sprintf("http://%s:%d", ipadres, port)
+	registration.HomePageUrl = getOrDefault(service, "home_page_url", baseUrl+"/")
+	registration.StatusPageUrl = getOrDefault(service, "status_page_url", baseUrl+"/info")
+	registration.HealthCheckUrl = getOrDefault(service, "health_check_url", baseUrl+service.Attrs["check_http"])
+	if url := service.Attrs["secure_health_check_url"]; url != "" {
+		registration.SecureHealthCheckUrl = url
 	}
+
+	registration.DataCenterInfo = dataCenterInfo()
+
+	return registration
 }
 
-func checkHealthTick(registeredService *RegisteredService, client *eureka.Client) {
-	for {
-		select {
-		case <-registeredService.ticker.C:
-			checkHealth(registeredService, client)
-		case <-registeredService.stop:
-			log.Println("Stop health checking", registeredService.registration.InstanceId)
-			registeredService.ticker.Stop()
-			return
+func getOrDefault(service *bridge.Service, attr string, defaultValue string) string {
+	if v := service.Attrs[attr]; v != "" {
+		return v
+	}
+	return defaultValue
+}
+func createMetadataMap(registration *eureka.InstanceInfo) {
+	if registration.Metadata == nil {
+		registration.Metadata = &eureka.MetaData{
+			Map: make(map[string]string),
 		}
 	}
 }
@@ -206,9 +315,8 @@ func (r *EurekaAdapter) Register(service *bridge.Service) error {
 	}
 	registration := instanceInformation(service)
 
-	var registeredService RegisteredService
-	if path := service.Attrs["check_http"]; path != "" {
-		statusUrl := fmt.Sprintf("http://%s:%d%s", service.IP, service.Port, path)
+	var registeredService *RegisteredService
+	if checker, present := selectHealthChecker(service); present {
 
 		// In case of a restart/redeploy the container is probably already running for a long time, we should not mark it as STARTING
 		// In case of docker daemon all containers get restarted, so status might be wrong
@@ -216,7 +324,9 @@ func (r *EurekaAdapter) Register(service *bridge.Service) error {
 		if oldRegistration != nil {
 			if !exactMatch {
 				//Potential ghost container, same application, same machine different port found after restart
+				r.servicesMutex.Lock()
 				_, existing := r.registeredServices[oldRegistration.InstanceId]
+				r.servicesMutex.Unlock()
 				if !existing {
 					//Remove from Eureka
 					log.Println("Ghost container found with instanceId: " , oldRegistration.InstanceId)
@@ -229,7 +339,7 @@ func (r *EurekaAdapter) Register(service *bridge.Service) error {
 			} else {
 				// Same container (with same instanceID) is already registered, we directly check the real status
 				log.Println("Container with instanceId: ", oldRegistration.InstanceId , "found, directly checking its status")
-				registration.Status = getCurrentStatus(statusUrl)
+				registration.Status = checker.Check()
 				log.Println("Container with instanceId: ", oldRegistration.InstanceId, " will get status: ", registration.Status)
 			}
 		} else {
@@ -238,24 +348,29 @@ func (r *EurekaAdapter) Register(service *bridge.Service) error {
 		}
 
 		interval := getCheckInterval(service)
-		quit := make(chan struct{})
-		ticker := time.NewTicker(time.Duration(interval) * time.Second)
-		registeredService = RegisteredService{registration: registration, ticker: ticker, stop: quit, statusUrl: statusUrl}
-		go checkHealthTick(&registeredService, r.client)
+		registeredService = &RegisteredService{registration: registration, checker: checker, deregisterAfter: getDeregisterAfter(service)}
+		registeredService.cancel = r.scheduler.schedule(time.Duration(interval)*time.Second, func() {
+			r.checkHealth(registeredService)
+		})
 	} else {
 		registration.Status = "UP"
-		registeredService = RegisteredService{registration: registration}
+		registeredService = &RegisteredService{registration: registration}
 	}
 
+	r.servicesMutex.Lock()
 	r.registeredServices[registration.InstanceId] = registeredService
 	if status := service.Attrs["check_initial_status"]; status != "" {
 		registration.Status = status
 	}
+	r.servicesMutex.Unlock()
 	log.Println("Registering ", registration.InstanceId, "with status", registration.Status)
 	return r.client.RegisterInstance(registration)
 }
 
 func (r *EurekaAdapter) findOldRegistration(registration *eureka.InstanceInfo) (*eureka.InstanceInfo, bool) {
+	r.knownMutex.Lock()
+	defer r.knownMutex.Unlock()
+
 	application, found := r.knownApplications[registration.App]
 	if found {
 		for _, instance := range application.Instances {
@@ -277,11 +392,14 @@ func (r *EurekaAdapter) Deregister(service *bridge.Service) error {
 	}
 	registration := instanceInformation(service)
 	log.Println("Deregistering ", registration.InstanceId)
+	r.servicesMutex.Lock()
 	registeredService := r.registeredServices[registration.InstanceId]
-	if registeredService.stop != nil {
-		close(registeredService.stop)
-	}
 	delete(r.registeredServices, registration.InstanceId)
+	r.servicesMutex.Unlock()
+	if registeredService != nil && registeredService.cancel != nil {
+		registeredService.cancel()
+	}
+	r.scheduler.cancelPending(registration.InstanceId)
 	return r.client.UnregisterInstance(registration)
 }
 
@@ -290,13 +408,40 @@ func (r *EurekaAdapter) Refresh(service *bridge.Service) error {
 		return nil
 	}
 	registration := instanceInformation(service)
+	r.servicesMutex.Lock()
 	registeredService := r.registeredServices[registration.InstanceId]
-	succeeded := r.client.SendHeartbeat(registeredService.registration)
+	r.servicesMutex.Unlock()
+	if registeredService == nil {
+		return r.client.RegisterInstance(registration)
+	}
+	succeeded, overriddenStatus := r.client.SendHeartbeat(registeredService.registration)
 	if !succeeded {
 		return r.client.RegisterInstance(registeredService.registration)
-	} else {
-		return nil
 	}
+	r.applyHeartbeatOverride(registeredService, overriddenStatus)
+	return nil
+}
+
+// applyHeartbeatOverride reacts to an override status carried directly on a
+// heartbeat response the same way reconcileOverrides reacts to one seen in a
+// periodic Ping poll, including clearing overridden once the server no
+// longer reports one, so an override applied or lifted between two Ping
+// polls still takes effect on the next heartbeat instead of waiting for the
+// next poll.
+func (r *EurekaAdapter) applyHeartbeatOverride(registeredService *RegisteredService, overriddenStatus string) {
+	r.servicesMutex.Lock()
+	defer r.servicesMutex.Unlock()
+
+	if overriddenStatus == "" || overriddenStatus == "UNKNOWN" {
+		registeredService.overridden = false
+		return
+	}
+
+	if registeredService.registration.Status != overriddenStatus {
+		log.Println("Status override", overriddenStatus, "in effect for", registeredService.registration.InstanceId, ", suppressing local health checks")
+		registeredService.registration.Status = overriddenStatus
+	}
+	registeredService.overridden = true
 }
 
 func (r *EurekaAdapter) Services() ([]*bridge.Service, error) {
@@ -0,0 +1,81 @@
+package eureka
+
+import (
+	"testing"
+
+	"github.com/pdok/go-eureka-client/eureka"
+)
+
+func TestComputeAppsHashcode(t *testing.T) {
+	apps := map[string]eureka.Application{
+		"APP-A": {
+			Name: "APP-A",
+			Instances: []eureka.InstanceInfo{
+				{InstanceId: "a1", Status: "UP"},
+				{InstanceId: "a2", Status: "UP"},
+			},
+		},
+		"APP-B": {
+			Name: "APP-B",
+			Instances: []eureka.InstanceInfo{
+				{InstanceId: "b1", Status: "DOWN"},
+			},
+		},
+	}
+
+	got := computeAppsHashcode(apps)
+	want := "DOWN_1_UP_2_"
+	if got != want {
+		t.Errorf("computeAppsHashcode() = %q, want %q", got, want)
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	r := &EurekaAdapter{knownApplications: make(map[string]eureka.Application)}
+
+	r.applyDelta("APP-A", eureka.InstanceInfo{InstanceId: "a1", Status: "UP", ActionType: "ADDED"})
+	r.applyDelta("APP-A", eureka.InstanceInfo{InstanceId: "a2", Status: "UP", ActionType: "ADDED"})
+	if got := len(r.knownApplications["APP-A"].Instances); got != 2 {
+		t.Fatalf("after two ADDED deltas, got %d instances, want 2", got)
+	}
+
+	r.applyDelta("APP-A", eureka.InstanceInfo{InstanceId: "a1", Status: "DOWN", ActionType: "MODIFIED"})
+	app := r.knownApplications["APP-A"]
+	if len(app.Instances) != 2 {
+		t.Fatalf("MODIFIED delta changed instance count to %d, want 2", len(app.Instances))
+	}
+	for _, inst := range app.Instances {
+		if inst.InstanceId == "a1" && inst.Status != "DOWN" {
+			t.Errorf("a1 status = %q, want DOWN after MODIFIED delta", inst.Status)
+		}
+	}
+
+	r.applyDelta("APP-A", eureka.InstanceInfo{InstanceId: "a1", ActionType: "DELETED"})
+	app = r.knownApplications["APP-A"]
+	if len(app.Instances) != 1 || app.Instances[0].InstanceId != "a2" {
+		t.Fatalf("after DELETED delta, got %+v, want only a2 remaining", app.Instances)
+	}
+}
+
+func TestApplyHeartbeatOverrideClearsOnceLifted(t *testing.T) {
+	r := &EurekaAdapter{}
+	registeredService := &RegisteredService{
+		registration: &eureka.InstanceInfo{InstanceId: "a1", Status: "OUT_OF_SERVICE"},
+		overridden:   true,
+	}
+
+	r.applyHeartbeatOverride(registeredService, "")
+	if registeredService.overridden {
+		t.Errorf("overridden should clear once the heartbeat reports no override")
+	}
+
+	r.applyHeartbeatOverride(registeredService, "DOWN")
+	if !registeredService.overridden || registeredService.registration.Status != "DOWN" {
+		t.Errorf("applyHeartbeatOverride did not apply the override: overridden=%v status=%v", registeredService.overridden, registeredService.registration.Status)
+	}
+
+	r.applyHeartbeatOverride(registeredService, "UNKNOWN")
+	if registeredService.overridden {
+		t.Errorf("overridden should also clear on an explicit UNKNOWN status")
+	}
+}
@@ -0,0 +1,218 @@
+package eureka
+
+import (
+	"context"
+	"fmt"
+	"github.com/gliderlabs/registrator/bridge"
+	"github.com/pdok/go-eureka-client/eureka"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// HealthChecker probes a single registered service and reports its current
+// Eureka status: "UP", "DOWN" or "STARTING".
+type HealthChecker interface {
+	Check() string
+}
+
+// selectHealthChecker picks the HealthChecker implied by whichever check_*
+// attribute is present on the service, preferring check_http for backwards
+// compatibility when more than one is set.
+func selectHealthChecker(service *bridge.Service) (HealthChecker, bool) {
+	if path := service.Attrs["check_http"]; path != "" {
+		statusUrl := fmt.Sprintf("http://%s:%d%s", service.IP, service.Port, path)
+		return &httpHealthChecker{statusUrl: statusUrl}, true
+	}
+	if service.Attrs["check_tcp"] != "" {
+		address := fmt.Sprintf("%s:%d", service.IP, service.Port)
+		return &tcpHealthChecker{address: address}, true
+	}
+	if command := service.Attrs["check_script"]; command != "" {
+		return &scriptHealthChecker{command: command, timeout: getCheckTimeout(service)}, true
+	}
+	if service.Attrs["check_grpc"] != "" {
+		address := fmt.Sprintf("%s:%d", service.IP, service.Port)
+		return &grpcHealthChecker{address: address, timeout: getCheckTimeout(service)}, true
+	}
+	return nil, false
+}
+
+func getCheckTimeout(service *bridge.Service) time.Duration {
+	if service.Attrs["check_timeout"] != "" {
+		v, err := strconv.Atoi(service.Attrs["check_timeout"])
+		if err != nil {
+			log.Println("eureka: check_timeout must be valid int", err)
+			return 10 * time.Second
+		}
+		return time.Duration(v) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// getDeregisterAfter returns the number of consecutive failed health checks
+// after which the instance should be unregistered entirely, or 0 if the
+// check_deregister_after attribute isn't set.
+func getDeregisterAfter(service *bridge.Service) int {
+	if service.Attrs["check_deregister_after"] != "" {
+		v, err := strconv.Atoi(service.Attrs["check_deregister_after"])
+		if err != nil {
+			log.Println("eureka: check_deregister_after must be valid int", err)
+			return 0
+		}
+		return v
+	}
+	return 0
+}
+
+// httpHealthChecker marks the instance UP when statusUrl responds 200 OK.
+type httpHealthChecker struct {
+	statusUrl string
+}
+
+func (h *httpHealthChecker) Check() string {
+	resp, err := GetWithRetry(h.statusUrl)
+	if err != nil {
+		eureka.GetEurekaLogger().Errorf("Error in fetching status from url %s: %s", h.statusUrl, err.Error())
+		return "DOWN"
+	}
+	defer resp.Body.Close()
+	body, parseError := ioutil.ReadAll(resp.Body)
+
+	if parseError != nil {
+		eureka.GetEurekaLogger().Errorf("Error parsing response body from url %s body: %s", h.statusUrl, parseError.Error())
+		return "DOWN"
+	}
+	if resp.StatusCode == http.StatusOK {
+		eureka.GetEurekaLogger().Debug("Service is UP")
+		return "UP"
+	}
+	eureka.GetEurekaLogger().Errorf("Service is DOWN. Response from %s: %s", h.statusUrl, string(body))
+	return "DOWN"
+}
+
+func GetWithRetry(url string) (*http.Response, error) {
+	timeout := time.Duration(15 * time.Second)
+	client := http.Client{
+		Timeout: timeout,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		eureka.GetEurekaLogger().Errorf("First attempt failed, error in fetching url %s: %s", url, err.Error())
+		return client.Get(url)
+	}
+	return resp, err
+}
+
+// tcpHealthChecker marks the instance UP when it can open a TCP connection to address.
+type tcpHealthChecker struct {
+	address string
+}
+
+func (h *tcpHealthChecker) Check() string {
+	conn, err := net.DialTimeout("tcp", h.address, 5*time.Second)
+	if err != nil {
+		eureka.GetEurekaLogger().Errorf("Error connecting to %s: %s", h.address, err.Error())
+		return "DOWN"
+	}
+	conn.Close()
+	return "UP"
+}
+
+// scriptHealthChecker marks the instance UP when command exits 0 within timeout.
+type scriptHealthChecker struct {
+	command string
+	timeout time.Duration
+}
+
+func (h *scriptHealthChecker) Check() string {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.command)
+	if err := cmd.Run(); err != nil {
+		eureka.GetEurekaLogger().Errorf("Error running check_script %q: %s", h.command, err.Error())
+		return "DOWN"
+	}
+	return "UP"
+}
+
+// grpcHealthChecker marks the instance according to the standard gRPC health
+// probe protocol (grpc.health.v1.Health/Check).
+type grpcHealthChecker struct {
+	address string
+	timeout time.Duration
+}
+
+func (h *grpcHealthChecker) Check() string {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, h.address, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		eureka.GetEurekaLogger().Errorf("Error dialing grpc health endpoint %s: %s", h.address, err.Error())
+		return "DOWN"
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		eureka.GetEurekaLogger().Errorf("Error calling grpc health check on %s: %s", h.address, err.Error())
+		return "DOWN"
+	}
+
+	switch resp.Status {
+	case grpc_health_v1.HealthCheckResponse_SERVING:
+		return "UP"
+	case grpc_health_v1.HealthCheckResponse_UNKNOWN:
+		return "STARTING"
+	default:
+		return "DOWN"
+	}
+}
+
+func (r *EurekaAdapter) checkHealth(registeredService *RegisteredService) {
+	r.servicesMutex.Lock()
+	overridden := registeredService.overridden
+	r.servicesMutex.Unlock()
+	if overridden {
+		return
+	}
+
+	r.servicesMutex.Lock()
+	currentStatus := registeredService.registration.Status
+	r.servicesMutex.Unlock()
+	newStatus := registeredService.checker.Check()
+
+	if newStatus == "DOWN" {
+		registeredService.consecutiveFails++
+	} else {
+		registeredService.consecutiveFails = 0
+	}
+
+	if registeredService.deregisterAfter > 0 && registeredService.consecutiveFails >= registeredService.deregisterAfter {
+		log.Println("Health check failed", registeredService.consecutiveFails, "times for", registeredService.registration.InstanceId, ", deregistering")
+		r.client.UnregisterInstance(registeredService.registration)
+		r.servicesMutex.Lock()
+		delete(r.registeredServices, registeredService.registration.InstanceId)
+		r.servicesMutex.Unlock()
+		r.scheduler.cancelPending(registeredService.registration.InstanceId)
+		if registeredService.cancel != nil {
+			registeredService.cancel()
+		}
+		return
+	}
+
+	if currentStatus != newStatus {
+		r.servicesMutex.Lock()
+		registeredService.registration.Status = newStatus
+		r.servicesMutex.Unlock()
+		r.scheduler.queueWrite(registeredService.registration) //Coalesce status change into a batched write
+	}
+}
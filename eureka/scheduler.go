@@ -0,0 +1,173 @@
+package eureka
+
+import (
+	"github.com/pdok/go-eureka-client/eureka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const batchWindow = 500 * time.Millisecond
+
+var (
+	schedulerQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "registrator",
+		Subsystem: "eureka",
+		Name:      "scheduler_queue_depth",
+		Help:      "Number of health checks currently scheduled by the eureka adapter.",
+	})
+	schedulerWriteLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "registrator",
+		Subsystem: "eureka",
+		Name:      "scheduler_write_latency_seconds",
+		Help:      "Latency of batched RegisterInstance writes to Eureka.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(schedulerQueueDepth, schedulerWriteLatency)
+}
+
+// scheduler runs every registered service's health check on its own jittered
+// interval, instead of each service owning a time.Ticker, and coalesces the
+// resulting status transitions into batched RegisterInstance writes. Note
+// that "batched" only dedupes repeated writes for the *same* instance within
+// batchWindow: the vendored Eureka client has no bulk registration endpoint,
+// so a flush with N distinct instances still fires N sequential
+// RegisterInstance requests (see serverCluster.RegisterInstances). Many
+// containers transitioning at once therefore still produce one request per
+// instance, just no longer one request per individual status flap.
+type scheduler struct {
+	adapter *EurekaAdapter
+
+	mu      sync.Mutex
+	pending map[string]*eureka.InstanceInfo
+	flush   *time.Timer
+}
+
+func newScheduler(adapter *EurekaAdapter) *scheduler {
+	startMetricsServer()
+	return &scheduler{adapter: adapter, pending: make(map[string]*eureka.InstanceInfo)}
+}
+
+// schedule runs checkFunc every interval, jittered by +/-20% on the first
+// tick, until the returned cancel func is called.
+func (s *scheduler) schedule(interval time.Duration, checkFunc func()) func() {
+	stop := make(chan struct{})
+	timer := time.NewTimer(jitter(interval))
+	schedulerQueueDepth.Inc()
+
+	go func() {
+		defer schedulerQueueDepth.Dec()
+		for {
+			select {
+			case <-timer.C:
+				checkFunc()
+				timer.Reset(interval)
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+func jitter(interval time.Duration) time.Duration {
+	spread := float64(interval) * 0.2
+	delta := (rand.Float64()*2 - 1) * spread
+	return interval + time.Duration(delta)
+}
+
+// queueWrite coalesces status transitions arriving within batchWindow into a
+// single flush instead of one RegisterInstance call per transition. This only
+// helps when the same instance flaps repeatedly inside the window; it does
+// not reduce request volume across distinct instances (see RegisterInstances).
+func (s *scheduler) queueWrite(registration *eureka.InstanceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[registration.InstanceId] = registration
+	if s.flush == nil {
+		s.flush = time.AfterFunc(batchWindow, s.flushPending)
+	}
+}
+
+// cancelPending drops a queued-but-not-yet-flushed write, so a deregistered
+// instance doesn't get silently re-registered when the batch flushes.
+func (s *scheduler) cancelPending(instanceId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, instanceId)
+}
+
+func (s *scheduler) flushPending() {
+	s.mu.Lock()
+	batch := make([]*eureka.InstanceInfo, 0, len(s.pending))
+	for _, registration := range s.pending {
+		batch = append(batch, registration)
+	}
+	s.pending = make(map[string]*eureka.InstanceInfo)
+	s.flush = nil
+	s.mu.Unlock()
+
+	batch = s.dropDeregistered(batch)
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	if failed, err := s.adapter.client.RegisterInstances(batch); err != nil {
+		log.Println("eureka: batched RegisterInstance failed for", failed, "of", len(batch), "instance(s):", err)
+	}
+	schedulerWriteLatency.Observe(time.Since(start).Seconds())
+}
+
+// dropDeregistered re-checks each instance against registeredServices right
+// before the batch write goes out. cancelPending only protects an instance
+// that is still queued: if Deregister runs after flushPending already took
+// its snapshot (and released s.mu) but before flushPending's
+// RegisterInstances call, the batch would otherwise still land on the cluster and silently
+// re-register an instance that was just torn down.
+func (s *scheduler) dropDeregistered(batch []*eureka.InstanceInfo) []*eureka.InstanceInfo {
+	s.adapter.servicesMutex.Lock()
+	defer s.adapter.servicesMutex.Unlock()
+
+	live := batch[:0]
+	for _, registration := range batch {
+		if _, ok := s.adapter.registeredServices[registration.InstanceId]; ok {
+			live = append(live, registration)
+		} else {
+			log.Println("eureka: dropping batched write for", registration.InstanceId, ", deregistered before flush")
+		}
+	}
+	return live
+}
+
+// startMetricsServer exposes the scheduler's Prometheus metrics on /metrics
+// when EUREKA_METRICS_ADDR is set.
+func startMetricsServer() {
+	addr := os.Getenv("EUREKA_METRICS_ADDR")
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		log.Println("eureka: metrics endpoint listening on", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Println("eureka: metrics endpoint stopped:", err)
+		}
+	}()
+}
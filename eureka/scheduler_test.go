@@ -0,0 +1,57 @@
+package eureka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pdok/go-eureka-client/eureka"
+)
+
+func TestJitterWithinBounds(t *testing.T) {
+	interval := 30 * time.Second
+	lower := time.Duration(float64(interval) * 0.8)
+	upper := time.Duration(float64(interval) * 1.2)
+
+	for i := 0; i < 100; i++ {
+		if got := jitter(interval); got < lower || got > upper {
+			t.Fatalf("jitter(%v) = %v, want within [%v, %v]", interval, got, lower, upper)
+		}
+	}
+}
+
+func TestQueueWriteCoalescesSameInstance(t *testing.T) {
+	s := &scheduler{adapter: &EurekaAdapter{}, pending: make(map[string]*eureka.InstanceInfo)}
+	defer func() {
+		if s.flush != nil {
+			s.flush.Stop()
+		}
+	}()
+
+	s.queueWrite(&eureka.InstanceInfo{InstanceId: "i1", Status: "STARTING"})
+	s.queueWrite(&eureka.InstanceInfo{InstanceId: "i1", Status: "UP"})
+	s.queueWrite(&eureka.InstanceInfo{InstanceId: "i2", Status: "UP"})
+
+	if len(s.pending) != 2 {
+		t.Fatalf("pending has %d entries, want 2 (one per distinct instance)", len(s.pending))
+	}
+	if got := s.pending["i1"].Status; got != "UP" {
+		t.Errorf("pending[i1].Status = %q, want latest write UP", got)
+	}
+}
+
+func TestDropDeregisteredFiltersTornDownInstances(t *testing.T) {
+	adapter := &EurekaAdapter{registeredServices: map[string]*RegisteredService{
+		"i1": {},
+	}}
+	s := &scheduler{adapter: adapter}
+
+	batch := []*eureka.InstanceInfo{
+		{InstanceId: "i1"},
+		{InstanceId: "i2"},
+	}
+
+	got := s.dropDeregistered(batch)
+	if len(got) != 1 || got[0].InstanceId != "i1" {
+		t.Fatalf("dropDeregistered() = %+v, want only i1", got)
+	}
+}